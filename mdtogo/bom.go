@@ -0,0 +1,244 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultBOMThreshold is the minimum Jaccard similarity a LICENSE file must
+// have with a bundled template before it is reported as a match.
+const defaultBOMThreshold = 0.9
+
+// licenseFileNames are the file names checked, in order, when looking for a
+// dependency's license within its module directory.
+var licenseFileNames = []string{
+	"LICENSE", "LICENSE.txt", "LICENSE.md",
+	"LICENSE-2.0.txt", "COPYING", "COPYING.txt",
+}
+
+//go:embed licensetemplates/*.txt
+var licenseTemplateFS embed.FS
+
+// licenseMatch is a single classification of a dependency's license file
+// against one of the bundled templates, emitted as an entry in the BOM.
+type licenseMatch struct {
+	Type       string  `json:"type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// bomEntry is the bill-of-materials record for a single dependency.
+type bomEntry struct {
+	Project  string         `json:"project"`
+	Licenses []licenseMatch `json:"licenses"`
+}
+
+// licenseTemplate is a bundled reference license, tokenized once at startup
+// so every candidate LICENSE file can be compared against it cheaply.
+type licenseTemplate struct {
+	name  string
+	words map[string]bool
+}
+
+// tokenRE matches the words mdtogo classifies licenses by; it intentionally
+// ignores punctuation so minor reformatting of a LICENSE file doesn't affect
+// classification.
+var tokenRE = regexp.MustCompile(`[\w']+`)
+
+// copyrightLineRE strips the copyright line(s) that every LICENSE file
+// customizes with project-specific names and years, since those words would
+// otherwise dilute the similarity score against the bundled templates.
+var copyrightLineRE = regexp.MustCompile(`(?i)^\s*copyright\b.*$`)
+
+// loadLicenseTemplates tokenizes the bundled license corpus into word sets
+// keyed by SPDX-style identifier (derived from the embedded file name).
+func loadLicenseTemplates() ([]licenseTemplate, error) {
+	entries, err := fs.ReadDir(licenseTemplateFS, "licensetemplates")
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []licenseTemplate
+	for _, e := range entries {
+		b, err := licenseTemplateFS.ReadFile(filepath.Join("licensetemplates", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		templates = append(templates, licenseTemplate{
+			name:  name,
+			words: tokenize(string(b)),
+		})
+	}
+	return templates, nil
+}
+
+// tokenize normalizes license text into the word-set used for similarity
+// comparisons: copyright lines are dropped, the rest is lower-cased and
+// split on the same token pattern used by coreos/license-bill-of-materials.
+func tokenize(text string) map[string]bool {
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		if copyrightLineRE.MatchString(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	words := make(map[string]bool)
+	for _, tok := range tokenRE.FindAllString(strings.ToLower(strings.Join(kept, "\n")), -1) {
+		words[tok] = true
+	}
+	return words
+}
+
+// jaccard returns the Jaccard similarity between two word sets: the size of
+// their intersection divided by the size of their union.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for w := range a {
+		if b[w] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	return float64(intersection) / float64(union)
+}
+
+// classifyLicense compares a LICENSE file's contents against every bundled
+// template and returns the matches scoring at or above threshold, sorted by
+// descending confidence.
+func classifyLicense(text string, templates []licenseTemplate, threshold float64) []licenseMatch {
+	words := tokenize(text)
+
+	matches := []licenseMatch{}
+	for _, t := range templates {
+		if score := jaccard(words, t.words); score >= threshold {
+			matches = append(matches, licenseMatch{Type: t.name, Confidence: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+	return matches
+}
+
+// goListModule is the subset of `go list -m -json` we need to locate a
+// dependency's on-disk directory.
+type goListModule struct {
+	Path    string `json:"Path"`
+	Version string `json:"Version"`
+	Dir     string `json:"Dir"`
+	Main    bool   `json:"Main"`
+}
+
+// listModules shells out to `go list -m -json all`, run from moduleDir, and
+// decodes the streamed JSON objects it prints (one per module).
+func listModules(moduleDir string) ([]goListModule, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	cmd.Dir = moduleDir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list -m -json all: %v: %s", err, stderr.String())
+	}
+
+	var modules []goListModule
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var m goListModule
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+		if m.Main {
+			continue
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// findLicenseFile returns the path to the first recognized LICENSE file
+// within dir, or "" if none of the known names are present.
+func findLicenseFile(dir string) string {
+	for _, name := range licenseFileNames {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// generateBOM classifies the license of every dependency of the Go module
+// rooted at moduleDir and writes the result to bomPath as a JSON array of
+// bomEntry, sorted by project name. It returns an error if any dependency's
+// license could not be classified and allowUnknown is false.
+func generateBOM(moduleDir, bomPath string, threshold float64, allowUnknown bool) error {
+	templates, err := loadLicenseTemplates()
+	if err != nil {
+		return fmt.Errorf("loading license templates: %v", err)
+	}
+
+	modules, err := listModules(moduleDir)
+	if err != nil {
+		return fmt.Errorf("listing modules: %v", err)
+	}
+
+	var entries []bomEntry
+	var unknown []string
+	for _, m := range modules {
+		entry := bomEntry{Project: m.Path, Licenses: []licenseMatch{}}
+
+		if m.Dir != "" {
+			if licensePath := findLicenseFile(m.Dir); licensePath != "" {
+				b, err := ioutil.ReadFile(licensePath)
+				if err != nil {
+					return fmt.Errorf("reading %s: %v", licensePath, err)
+				}
+				entry.Licenses = classifyLicense(string(b), templates, threshold)
+			}
+		}
+
+		if len(entry.Licenses) == 0 {
+			unknown = append(unknown, entry.Project)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Project < entries[j].Project
+	})
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(bomPath, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+
+	if len(unknown) > 0 && !allowUnknown {
+		return fmt.Errorf("unable to classify license for: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
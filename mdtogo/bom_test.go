@@ -0,0 +1,29 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestBOMEntryUnknownLicenseSerializesEmptyArray guards against a dependency
+// with no classified license round-tripping through json.Marshal as
+// "licenses": null -- the BOM format requires an empty array instead.
+func TestBOMEntryUnknownLicenseSerializesEmptyArray(t *testing.T) {
+	entry := bomEntry{Project: "example.com/unknown", Licenses: classifyLicense("not a license", nil, defaultBOMThreshold)}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), `"licenses":null`) {
+		t.Errorf("unknown license serialized as null, want []: %s", b)
+	}
+	if !strings.Contains(string(b), `"licenses":[]`) {
+		t.Errorf("expected an empty licenses array, got: %s", b)
+	}
+}
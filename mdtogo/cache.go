@@ -0,0 +1,149 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// cachedDoc is the on-disk representation of a doc, stored together with the
+// SHA-256 of the source .md file that produced it so a subsequent run can
+// tell whether the file needs reparsing. Deps holds the same hash for every file pulled
+// in via a mdtogo:include directive, since an unchanged source file can
+// still need reparsing if a file it includes has changed.
+type cachedDoc struct {
+	Hash      string            `json:"hash"`
+	Name      string            `json:"name"`
+	Fields    map[string]string `json:"fields"`
+	RawFields map[string]string `json:"rawFields"`
+	Deps      map[string]string `json:"deps,omitempty"`
+}
+
+// mdtogoCache is a content-addressed cache of parsed docs, persisted as a
+// single JSON file keyed by source file path. When path is empty nothing is
+// read from or written to disk, though store, lookup and prune still act on
+// the in-memory entries for the current run. depHashes memoizes the hash
+// of each dependency file read during the run, since a shared include
+// fragment is typically depended on by many source files and otherwise
+// would be re-read and re-hashed once per dependent.
+type mdtogoCache struct {
+	path      string
+	entries   map[string]cachedDoc
+	dirty     bool
+	depHashes map[string]string
+}
+
+// loadCache reads path, if set, into a mdtogoCache. A missing or unreadable
+// cache file is treated as an empty cache rather than an error, since the
+// cache is purely an optimization.
+func loadCache(path string) mdtogoCache {
+	c := mdtogoCache{path: path, entries: map[string]cachedDoc{}, depHashes: map[string]string{}}
+	if path == "" {
+		return c
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	_ = json.Unmarshal(b, &c.entries)
+	return c
+}
+
+// hashOf returns the current hash of the file at path, memoized for the
+// lifetime of the cache so a dependency shared by many source files is only
+// read and hashed once per run.
+func (c mdtogoCache) hashOf(path string) (string, error) {
+	if h, ok := c.depHashes[path]; ok {
+		return h, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	h := fileHash(b)
+	c.depHashes[path] = h
+	return h, nil
+}
+
+// lookup returns the cached doc for sourcePath if present, its stored hash
+// matches hash, and every file it was recorded as depending on (via
+// mdtogo:include) still hashes to what was stored for it.
+func (c mdtogoCache) lookup(sourcePath, hash string) (doc, bool) {
+	entry, ok := c.entries[sourcePath]
+	if !ok || entry.Hash != hash {
+		return doc{}, false
+	}
+
+	for depPath, depHash := range entry.Deps {
+		h, err := c.hashOf(depPath)
+		if err != nil || h != depHash {
+			return doc{}, false
+		}
+	}
+
+	return doc{Name: entry.Name, Fields: entry.Fields, rawFields: entry.RawFields}, true
+}
+
+// store records d as the parsed result for sourcePath at hash, along with
+// the current hash of every file in deps.
+func (c *mdtogoCache) store(sourcePath, hash string, d doc, deps map[string]bool) error {
+	depHashes := make(map[string]string, len(deps))
+	for depPath := range deps {
+		h, err := c.hashOf(depPath)
+		if err != nil {
+			return err
+		}
+		depHashes[depPath] = h
+	}
+
+	c.entries[sourcePath] = cachedDoc{
+		Hash:      hash,
+		Name:      d.Name,
+		Fields:    d.Fields,
+		RawFields: d.rawFields,
+		Deps:      depHashes,
+	}
+	c.dirty = true
+	return nil
+}
+
+// prune drops cache entries for source files that no longer exist, so a
+// renamed or deleted .md file doesn't leave a dead entry behind forever.
+func (c *mdtogoCache) prune(liveFiles []string) {
+	live := make(map[string]bool, len(liveFiles))
+	for _, f := range liveFiles {
+		live[f] = true
+	}
+
+	for path := range c.entries {
+		if !live[path] {
+			delete(c.entries, path)
+			c.dirty = true
+		}
+	}
+}
+
+// save writes the cache back to disk if it's enabled and has changed since
+// it was loaded.
+func (c mdtogoCache) save() error {
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0600)
+}
+
+// fileHash returns the hex-encoded SHA-256 of b.
+func fileHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestCacheIncludeInvalidation guards against the bug fixed in
+// e93bf1c: a cached doc must be invalidated not only when its own source
+// file changes, but when a file it pulled in via mdtogo:include changes,
+// even though the source file's own hash is unchanged.
+func TestCacheIncludeInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	fragment := filepath.Join(dir, "fragment.md")
+	if err := ioutil.WriteFile(fragment, []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sourcePath := filepath.Join(dir, "source.md")
+	sourceHash := "source-hash"
+	d := doc{
+		Name:      "X",
+		Fields:    map[string]string{"Long": "v1"},
+		rawFields: map[string]string{"Long": "v1"},
+	}
+	deps := map[string]bool{fragment: true}
+
+	c := loadCache("")
+	if err := c.store(sourcePath, sourceHash, d, deps); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.lookup(sourcePath, sourceHash); !ok {
+		t.Fatal("lookup should hit immediately after store")
+	}
+
+	if err := ioutil.WriteFile(fragment, []byte("v2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh cache simulates the next "mdtogo" run picking the persisted
+	// cache back up: within a single run a dependency's hash is memoized
+	// (it can't change mid-run), but a new run must re-read it.
+	c2 := loadCache("")
+	c2.entries[sourcePath] = c.entries[sourcePath]
+	if _, ok := c2.lookup(sourcePath, sourceHash); ok {
+		t.Fatal("lookup should miss once an included file changes, even though the source hash didn't")
+	}
+}
+
+// TestCachePrune guards against the second bug fixed in e93bf1c: entries
+// for source files that no longer exist (deleted or renamed) must be
+// dropped rather than accumulating forever.
+func TestCachePrune(t *testing.T) {
+	c := loadCache("")
+	c.entries["a.md"] = cachedDoc{Hash: "h1"}
+	c.entries["b.md"] = cachedDoc{Hash: "h2"}
+
+	c.prune([]string{"a.md"})
+
+	if _, ok := c.entries["a.md"]; !ok {
+		t.Error("prune should keep entries for files still present")
+	}
+	if _, ok := c.entries["b.md"]; ok {
+		t.Error("prune should drop entries for files no longer present")
+	}
+	if !c.dirty {
+		t.Error("prune should mark the cache dirty when it drops an entry")
+	}
+}
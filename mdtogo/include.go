@@ -0,0 +1,74 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+)
+
+// includeTag matches an mdtogo include directive, which inlines a named
+// block from another .md file: <!--mdtogo:include path/to/fragment.md#Name-->
+var includeTag = regexp.MustCompile(`<!--mdtogo:include\s+(\S+?)#([A-Z][A-Za-z0-9]*)\s*-->`)
+
+// resolveIncludes expands every mdtogo:include directive found in content,
+// resolving paths relative to sourceRoot, and recursively resolves includes
+// found in the content it pulls in. visiting tracks the "path#Name" pairs
+// currently being expanded so that a cycle between includes is reported as
+// an error instead of recursing forever. Every file read to satisfy an
+// include is recorded in deps, keyed by its path, so callers (the cache) can
+// tell when a file has to be reparsed because one of its includes changed,
+// even though the file's own bytes didn't.
+func resolveIncludes(sourceRoot, content string, visiting map[string]bool, deps map[string]bool) (string, error) {
+	var err error
+	expanded := includeTag.ReplaceAllStringFunc(content, func(tag string) string {
+		if err != nil {
+			return tag
+		}
+
+		m := includeTag.FindStringSubmatch(tag)
+		relPath, varName := m[1], m[2]
+		key := relPath + "#" + varName
+
+		if visiting[key] {
+			err = fmt.Errorf("mdtogo:include cycle detected at %s", key)
+			return tag
+		}
+
+		deps[filepath.Join(sourceRoot, relPath)] = true
+
+		var fragment string
+		fragment, err = includedBlock(sourceRoot, relPath, varName)
+		if err != nil {
+			return tag
+		}
+
+		visiting[key] = true
+		fragment, err = resolveIncludes(sourceRoot, fragment, visiting, deps)
+		delete(visiting, key)
+		return fragment
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// includedBlock reads relPath, resolved against sourceRoot, and returns the
+// raw content of its varName mdtogo block.
+func includedBlock(sourceRoot, relPath, varName string) (string, error) {
+	path := filepath.Join(sourceRoot, relPath)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("mdtogo:include %s#%s: %v", relPath, varName, err)
+	}
+
+	block, ok := extractRawBlocks(b)[varName]
+	if !ok {
+		return "", fmt.Errorf("mdtogo:include %s#%s: block not found", relPath, varName)
+	}
+	return block, nil
+}
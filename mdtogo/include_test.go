@@ -0,0 +1,87 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolveIncludesCycle exercises a direct include cycle -- a.md#X
+// includes b.md#Y, which includes a.md#X back -- and asserts it's reported
+// as an error instead of recursing forever or silently succeeding.
+func TestResolveIncludesCycle(t *testing.T) {
+	dir := t.TempDir()
+
+	aContent := "<!--mdtogo:X-->\nstart\n<!--mdtogo:include b.md#Y-->\n<!--mdtogo-->\n"
+	bContent := "<!--mdtogo:Y-->\n<!--mdtogo:include a.md#X-->\n<!--mdtogo-->\n"
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.md"), []byte(aContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.md"), []byte(bContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rawX, ok := extractRawBlocks([]byte(aContent))["X"]
+	if !ok {
+		t.Fatal("block X not found in a.md")
+	}
+
+	_, err := resolveIncludes(dir, rawX, map[string]bool{}, map[string]bool{})
+	if err == nil {
+		t.Fatal("expected a cycle error, got nil")
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected error to mention a cycle, got: %v", err)
+	}
+}
+
+// TestResolveIncludesNoCycle is the non-cyclic control: a single include
+// with no recursion back to itself should resolve cleanly.
+func TestResolveIncludesNoCycle(t *testing.T) {
+	dir := t.TempDir()
+
+	bContent := "<!--mdtogo:Y-->\nhello\n<!--mdtogo-->\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.md"), []byte(bContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := map[string]bool{}
+	got, err := resolveIncludes(dir, "<!--mdtogo:include b.md#Y-->\n", map[string]bool{}, deps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(got, "hello") {
+		t.Errorf("expected included content to contain %q, got %q", "hello", got)
+	}
+	if !deps[filepath.Join(dir, "b.md")] {
+		t.Error("expected b.md to be recorded as a dependency")
+	}
+}
+
+// TestResolveIncludesNoStrayBlankLine guards against a fragment whose block
+// opens with a blank line (a normal authoring style) introducing an extra
+// blank line into the including document: resolveIncludes substitutes the
+// raw fragment verbatim with no trimming of its own, so the fragment's raw
+// text must already have that leading blank line stripped.
+func TestResolveIncludesNoStrayBlankLine(t *testing.T) {
+	dir := t.TempDir()
+
+	fragment := "<!--mdtogo:Snip-->\n\nhello world\n<!--mdtogo-->\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "fragment.md"), []byte(fragment), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "Intro line.\n<!--mdtogo:include fragment.md#Snip-->\nAfter.\n"
+	got, err := resolveIncludes(dir, content, map[string]bool{}, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "Intro line.\n\n") {
+		t.Errorf("include introduced a stray blank line: %q", got)
+	}
+}
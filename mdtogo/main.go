@@ -10,8 +10,8 @@
 // All *.md files will be read from DEST_GO_DIR/, including subdirectories if --recursive=true,
 // and a single DEST_GO_DIR/docs.go file is generated.
 //
-// The content for each of the three variables created per folder, are set
-// by looking for a HTML comment on one of two forms:
+// The content for each variable created per folder is set by looking for a
+// HTML comment on one of two forms:
 //
 // <!--mdtogo:<VARIABLE_NAME>-->
 //   ..some content..
@@ -26,7 +26,15 @@
 // The first are for content that should show up in the rendered HTML, while
 // the second is for content that should be hidden in the rendered HTML.
 //
-// <VARIABLE_NAME> must be one of Short, Long or Examples.
+// <VARIABLE_NAME> may be any name matching [A-Z][A-Za-z0-9]*, e.g. Short, Long,
+// Examples, SeeAlso or EnvVars -- whatever variables a package's commands need.
+//
+// A block may also pull in a block from another file with an include directive:
+//
+// <!--mdtogo:include path/to/fragment.md#VARIABLE_NAME-->
+//
+// path/to/fragment.md is resolved relative to SOURCE_MD_DIR/. Includes are expanded
+// recursively, and a cycle between includes is an error.
 //
 // Flags:
 //   --recursive=true
@@ -34,21 +42,45 @@
 //   --license
 //     Controls the license header added to the files.  Specify a path to a license file,
 //     or "none" to skip adding a license.
+//   --bom=path/to/bill-of-materials.json
+//     In addition to docs.go, classify the license of every dependency of the Go module
+//     rooted at SOURCE_MD_DIR/ and write the result to the given path. Classification is
+//     done by comparing each dependency's LICENSE file against a bundled corpus of common
+//     license templates; dependencies whose license can't be classified above
+//     --bom-threshold cause a nonzero exit unless --allow-unknown is set.
+//   --bom-threshold=0.9
+//     Minimum similarity (0-1) a LICENSE file must have with a bundled template to be
+//     reported as a match. Only used with --bom.
+//   --allow-unknown
+//     Don't fail when a dependency's license can't be classified. Only used with --bom.
+//   --man-dir=path/to/man
+//     In addition to docs.go, render each command's Short/Long/Examples to a groff
+//     man(7) page under the given directory, named kpt-<cmd>.1.
+//   --cache=.mdtogo-cache
+//     Cache each source .md file's extracted content, keyed by a hash of the file's
+//     bytes, so that an unchanged file doesn't need to be reparsed on the next run.
+//     docs.go itself is only rewritten if its content actually changed, so `go
+//     generate` is a no-op once the cache and docs.go are both up to date.
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 var recursive bool
 var licenseFile string
+var bomPath string
+var bomThreshold = defaultBOMThreshold
+var allowUnknownLicense bool
+var manDir string
+var cachePath string
 
 func main() {
 	for _, a := range os.Args {
@@ -58,6 +90,26 @@ func main() {
 		if strings.HasPrefix(a, "--license=") {
 			licenseFile = strings.ReplaceAll(a, "--license=", "")
 		}
+		if strings.HasPrefix(a, "--bom=") {
+			bomPath = strings.TrimPrefix(a, "--bom=")
+		}
+		if strings.HasPrefix(a, "--bom-threshold=") {
+			t, err := strconv.ParseFloat(strings.TrimPrefix(a, "--bom-threshold="), 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid --bom-threshold: %v\n", err)
+				os.Exit(1)
+			}
+			bomThreshold = t
+		}
+		if a == "--allow-unknown" {
+			allowUnknownLicense = true
+		}
+		if strings.HasPrefix(a, "--man-dir=") {
+			manDir = strings.TrimPrefix(a, "--man-dir=")
+		}
+		if strings.HasPrefix(a, "--cache=") {
+			cachePath = strings.TrimPrefix(a, "--cache=")
+		}
 	}
 
 	if len(os.Args) < 3 {
@@ -73,6 +125,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	cache := loadCache(cachePath)
+
 	var docs []doc
 	for _, path := range files {
 		b, err := ioutil.ReadFile(path)
@@ -80,11 +134,32 @@ func main() {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
 		}
-		parsedDoc := parse(path, string(b))
+
+		hash := fileHash(b)
+		if d, ok := cache.lookup(path, hash); ok {
+			docs = append(docs, d)
+			continue
+		}
+
+		parsedDoc, deps, err := parse(source, path, string(b))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if err := cache.store(path, hash, parsedDoc, deps); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 
 		docs = append(docs, parsedDoc)
 	}
 
+	cache.prune(files)
+	if err := cache.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
 	var license string
 
 	switch licenseFile {
@@ -115,21 +190,37 @@ package ` + filepath.Base(dest) + "\n"}
 	}
 
 	o := strings.Join(out, "\n")
-	err = ioutil.WriteFile(filepath.Join(dest, "docs.go"), []byte(o), 0600)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+	docsPath := filepath.Join(dest, "docs.go")
+	if existing, err := ioutil.ReadFile(docsPath); err != nil || string(existing) != o {
+		if err := ioutil.WriteFile(docsPath, []byte(o), 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if bomPath != "" {
+		if err := generateBOM(source, bomPath, bomThreshold, allowUnknownLicense); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if manDir != "" {
+		if err := writeManPages(docs, manDir); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 	}
 }
 
 func readFiles(source string) ([]string, error) {
 	filePaths := make([]string, 0)
 	if recursive {
-		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if filepath.Ext(info.Name()) == ".md" {
+			if filepath.Ext(d.Name()) == ".md" {
 				filePaths = append(filePaths, path)
 			}
 			return nil
@@ -138,99 +229,86 @@ func readFiles(source string) ([]string, error) {
 			return filePaths, err
 		}
 	} else {
-		files, err := ioutil.ReadDir(source)
+		entries, err := os.ReadDir(source)
 		if err != nil {
 			return filePaths, err
 		}
-		for _, info := range files {
-			if filepath.Ext(info.Name()) == ".md" {
-				path := filepath.Join(source, info.Name())
-				filePaths = append(filePaths, path)
+		for _, e := range entries {
+			if filepath.Ext(e.Name()) == ".md" {
+				filePaths = append(filePaths, filepath.Join(source, e.Name()))
 			}
 		}
 	}
 	return filePaths, nil
 }
 
-var (
-	mdtogoTag         = regexp.MustCompile(`<!--mdtogo:(Short|Long|Examples)-->([\s\S]*?)<!--mdtogo-->`)
-	mdtogoInternalTag = regexp.MustCompile(`<!--mdtogo:(Short|Long|Examples)\s+?([\s\S]*?)-->`)
-)
-
-func parse(path, value string) doc {
+// parse reads the mdtogo variable blocks out of an .md file's contents,
+// expanding any mdtogo:include directives relative to sourceRoot, and
+// returns the resulting doc together with the set of included files it
+// depended on (for cache invalidation). Blocks are located by walking a
+// CommonMark AST rather than scanning the raw text, so a fence or table
+// inside a block can't be mistaken for a mdtogo tag.
+func parse(sourceRoot, path, value string) (doc, map[string]bool, error) {
 	pathDir := filepath.Dir(path)
 	_, name := filepath.Split(pathDir)
 
 	name = strings.Title(name)
 	name = strings.ReplaceAll(name, "-", "")
 
-	matches := mdtogoTag.FindAllStringSubmatch(value, -1)
-	matches = append(matches, mdtogoInternalTag.FindAllStringSubmatch(value, -1)...)
-
-	var doc doc
-	for _, match := range matches {
-		switch match[1] {
-		case "Short":
-			val := strings.TrimSpace(match[2])
-			doc.Short = val
-		case "Long":
-			val := cleanUpContent(match[2])
-			doc.Long = val
-		case "Examples":
-			val := cleanUpContent(match[2])
-			doc.Examples = val
-		}
-	}
-	doc.Name = name
-	return doc
-}
-
-func cleanUpContent(text string) string {
-	var lines []string
+	d := doc{
+		Name:      name,
+		Fields:    map[string]string{},
+		rawFields: map[string]string{},
+	}
 
-	scanner := bufio.NewScanner(bytes.NewBufferString(strings.Trim(text, "\n")))
+	deps := map[string]bool{}
+	for varName, raw := range extractRawBlocks([]byte(value)) {
+		expanded, err := resolveIncludes(sourceRoot, raw, map[string]bool{}, deps)
+		if err != nil {
+			return doc{}, nil, fmt.Errorf("%s: %v", path, err)
+		}
 
-	indent := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "```") {
-			indent = !indent
+		if varName == "Short" {
+			if val := strings.TrimSpace(expanded); val != "" {
+				d.Fields[varName] = val
+				d.rawFields[varName] = val
+			}
 			continue
 		}
-
-		if indent {
-			line = "  " + line
+		if val := strings.Trim(expanded, "\n"); val != "" {
+			d.Fields[varName] = renderMarkdown(expanded)
+			d.rawFields[varName] = val
 		}
-
-		line = strings.ReplaceAll(line, "`", "` + \"`\" + `")
-
-		lines = append(lines, line)
 	}
-
-	return fmt.Sprintf("\n%s\n", strings.Join(lines, "\n"))
+	return d, deps, nil
 }
 
 type doc struct {
-	Name     string
-	Short    string
-	Long     string
-	Examples string
+	Name string
+
+	// Fields holds the content for every mdtogo variable block found in the
+	// source file, keyed by variable name (Short, Long, Examples, or any
+	// custom name a package defines), rendered to plain text and written to
+	// docs.go via goLiteral.
+	Fields map[string]string
+
+	// rawFields mirrors Fields before markdown rendering, for consumers
+	// (e.g. man page generation) that want to parse the original markdown
+	// structure.
+	rawFields map[string]string
 }
 
 func (d doc) String() string {
-	var parts []string
-
-	if d.Short != "" {
-		parts = append(parts,
-			fmt.Sprintf("var %sShort = `%s`", d.Name, d.Short))
+	names := make([]string, 0, len(d.Fields))
+	for varName := range d.Fields {
+		names = append(names, varName)
 	}
-	if d.Long != "" {
-		parts = append(parts,
-			fmt.Sprintf("var %sLong = `%s`", d.Name, d.Long))
-	}
-	if d.Examples != "" {
+	sort.Strings(names)
+
+	var parts []string
+	for _, varName := range names {
 		parts = append(parts,
-			fmt.Sprintf("var %sExamples = `%s`", d.Name, d.Examples))
+			fmt.Sprintf("var %s%s = %s", d.Name, varName, goLiteral(d.Fields[varName])))
 	}
 
 	return strings.Join(parts, "\n") + "\n"
@@ -0,0 +1,264 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// manCamelRE finds the boundary between a lowercase (or digit) rune and a
+// following uppercase rune, used to turn a doc's PascalCase Name back into
+// the hyphenated command name used in the man page file name.
+var manCamelRE = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// writeManPages renders a groff man(7) page for every doc with a Short or
+// Long description into manDir, named kpt-<cmd>.1.
+func writeManPages(docs []doc, manDir string) error {
+	if err := os.MkdirAll(manDir, 0700); err != nil {
+		return err
+	}
+
+	for _, d := range docs {
+		if d.rawFields["Short"] == "" && d.rawFields["Long"] == "" {
+			continue
+		}
+
+		cmd := manCommandName(d.Name)
+		path := filepath.Join(manDir, fmt.Sprintf("kpt-%s.1", cmd))
+		if err := ioutil.WriteFile(path, []byte(renderManPage(cmd, d)), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manCommandName converts a doc's PascalCase Name (e.g. "ConfigList") into
+// the lower, hyphenated command name used in man page file names and
+// .SH NAME sections (e.g. "config-list").
+func manCommandName(name string) string {
+	return strings.ToLower(manCamelRE.ReplaceAllString(name, "$1-$2"))
+}
+
+// renderManPage assembles the full troff source for a single command's man
+// page from its Short, Long and Examples blocks. Any other custom blocks the
+// package defines (e.g. SeeAlso) are rendered as their own .SH sections, in
+// the same sorted order docs.go emits them in.
+func renderManPage(cmd string, d doc) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, ".TH KPT-%s 1 \"\" \"kpt\" \"kpt Manual\"\n", strings.ToUpper(cmd))
+
+	fmt.Fprintf(&b, ".SH NAME\n")
+	if short := d.rawFields["Short"]; short != "" {
+		fmt.Fprintf(&b, "kpt %s \\- %s\n", strings.ReplaceAll(cmd, "-", " "), manEscape(short))
+	} else {
+		fmt.Fprintf(&b, "kpt %s\n", strings.ReplaceAll(cmd, "-", " "))
+	}
+
+	if long := d.rawFields["Long"]; long != "" {
+		fmt.Fprintf(&b, ".SH DESCRIPTION\n")
+		b.WriteString(renderManBlock(long))
+	}
+
+	if examples := d.rawFields["Examples"]; examples != "" {
+		fmt.Fprintf(&b, ".SH EXAMPLES\n")
+		b.WriteString(renderManBlock(examples))
+	}
+
+	for _, varName := range sortedCustomFieldNames(d) {
+		fmt.Fprintf(&b, ".SH %s\n", strings.ToUpper(varName))
+		b.WriteString(renderManBlock(d.rawFields[varName]))
+	}
+
+	return b.String()
+}
+
+// sortedCustomFieldNames returns the doc's field names other than the three
+// well-known ones already rendered by renderManPage, sorted for a stable
+// man page layout.
+func sortedCustomFieldNames(d doc) []string {
+	var names []string
+	for varName := range d.rawFields {
+		switch varName {
+		case "Short", "Long", "Examples":
+			continue
+		}
+		names = append(names, varName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderManBlock parses a raw markdown block with the same goldmark AST used
+// by renderMarkdown in mdast.go, and walks it to troff instead of plain
+// text, so man page rendering sees exactly the same block structure
+// (nested fences, tables, lists) as the cobra help output does.
+func renderManBlock(raw string) string {
+	source := []byte(strings.Trim(raw, "\n") + "\n")
+	reader := text.NewReader(source)
+	root := mdParser.Parser().Parse(reader)
+
+	var b strings.Builder
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		renderManNode(&b, n, source)
+	}
+	return b.String()
+}
+
+// renderManNode renders a single block-level AST node as troff.
+func renderManNode(b *strings.Builder, n ast.Node, source []byte) {
+	switch node := n.(type) {
+	case *ast.Heading:
+		fmt.Fprintf(b, ".SS %s\n", renderManInline(node, source))
+	case *ast.Paragraph, *ast.TextBlock:
+		fmt.Fprintf(b, ".PP\n%s\n", renderManInline(n, source))
+	case *ast.FencedCodeBlock:
+		b.WriteString(".EX\n")
+		renderManLines(b, node.Lines(), source)
+		b.WriteString(".EE\n")
+	case *ast.CodeBlock:
+		b.WriteString(".EX\n")
+		renderManLines(b, node.Lines(), source)
+		b.WriteString(".EE\n")
+	case *ast.List:
+		renderManList(b, node, source)
+	case *ast.Blockquote:
+		b.WriteString(".RS 4\n")
+		for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+			renderManNode(b, c, source)
+		}
+		b.WriteString(".RE\n")
+	case *ast.ThematicBreak:
+		b.WriteString(".PP\n")
+	case *extast.Table:
+		renderManTable(b, node, source)
+	default:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			renderManNode(b, c, source)
+		}
+	}
+}
+
+// renderManLines writes a fenced/indented code block's lines verbatim
+// (escaped for troff), preserving whatever the source already indented.
+func renderManLines(b *strings.Builder, lines *text.Segments, source []byte) {
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.WriteString(manEscape(strings.TrimRight(string(seg.Value(source)), "\n")))
+		b.WriteString("\n")
+	}
+}
+
+// renderManList renders each list item as a bulleted or numbered .IP entry.
+func renderManList(b *strings.Builder, node *ast.List, source []byte) {
+	i := node.Start
+	for item := node.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := `\(bu`
+		if node.IsOrdered() {
+			marker = strconv.Itoa(i) + "."
+			i++
+		}
+
+		var inner strings.Builder
+		for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+			renderManNode(&inner, c, source)
+		}
+		text := strings.TrimPrefix(strings.TrimSpace(inner.String()), ".PP\n")
+
+		fmt.Fprintf(b, ".IP %s 2\n%s\n", marker, text)
+	}
+}
+
+// renderManTable renders a table extension node using the tbl(1) macros
+// understood by groff/nroff, box-drawn with a header separator.
+func renderManTable(b *strings.Builder, node *extast.Table, source []byte) {
+	var rows [][]string
+	var headerRows int
+
+	for r := node.FirstChild(); r != nil; r = r.NextSibling() {
+		var row []string
+		for c := r.FirstChild(); c != nil; c = c.NextSibling() {
+			row = append(row, strings.TrimSpace(renderManInline(c, source)))
+		}
+		rows = append(rows, row)
+		if _, ok := r.(*extast.TableHeader); ok {
+			headerRows++
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	cols := len(rows[0])
+	spec := strings.Repeat("l ", cols)
+
+	b.WriteString(".TS\n")
+	b.WriteString("allbox;\n")
+	fmt.Fprintf(b, "%s.\n", spec)
+	for i, row := range rows {
+		b.WriteString(strings.Join(row, "\t"))
+		b.WriteString("\n")
+		if i == headerRows-1 {
+			b.WriteString("_\n")
+		}
+	}
+	b.WriteString(".TE\n")
+}
+
+// renderManInline renders the inline children of n back to troff-escaped
+// plain text, applying bold/italic font changes for emphasis and keeping
+// code spans in a constant-width font.
+func renderManInline(n ast.Node, source []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch in := c.(type) {
+		case *ast.Text:
+			b.WriteString(manEscape(string(in.Segment.Value(source))))
+			if in.SoftLineBreak() || in.HardLineBreak() {
+				b.WriteString("\n")
+			}
+		case *ast.CodeSpan:
+			b.WriteString(`\f[CR]` + renderManInline(in, source) + `\f[]`)
+		case *ast.Emphasis:
+			font := `\fI`
+			if in.Level > 1 {
+				font = `\fB`
+			}
+			b.WriteString(font + renderManInline(in, source) + `\fP`)
+		case *ast.Link:
+			fmt.Fprintf(&b, "%s (%s)", renderManInline(in, source), manEscape(string(in.Destination)))
+		case *ast.AutoLink:
+			b.WriteString(manEscape(string(in.URL(source))))
+		case *ast.RawHTML:
+			for i := 0; i < in.Segments.Len(); i++ {
+				seg := in.Segments.At(i)
+				b.Write(seg.Value(source))
+			}
+		default:
+			b.WriteString(renderManInline(c, source))
+		}
+	}
+	return b.String()
+}
+
+// manEscape escapes a line of prose for troff: backslashes and a leading
+// period or apostrophe (which troff would otherwise interpret as a macro).
+func manEscape(line string) string {
+	line = strings.ReplaceAll(line, `\`, `\e`)
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+		line = `\&` + line
+	}
+	return line
+}
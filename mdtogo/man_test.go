@@ -0,0 +1,87 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestRenderManPageStructure exercises renderManPage end to end, starting
+// from the same extractRawBlocks path that populates doc.rawFields for a
+// real file, so a regression there (e.g. a dropped opening heading) would
+// show up here as well as in TestRenderMarkdownGolden.
+func TestRenderManPageStructure(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/leading-heading.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, ok := extractRawBlocks(src)["Long"]
+	if !ok {
+		t.Fatal("block Long not found in testdata/leading-heading.md")
+	}
+
+	d := doc{
+		Name: "Foo",
+		rawFields: map[string]string{
+			"Short": "does a thing",
+			"Long":  long,
+		},
+	}
+
+	got := renderManPage("foo", d)
+	for _, want := range []string{
+		".SH NAME",
+		".SH DESCRIPTION",
+		".SS Synopsis",
+		"Description text follows the heading.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderManPage output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestRenderManPageTableAndFence asserts that a table and a fenced code
+// block in a Long section render to the tbl(1) and .EX/.EE troff macros,
+// instead of the raw pipes/backticks a line-based scanner would have
+// passed through verbatim.
+func TestRenderManPageTableAndFence(t *testing.T) {
+	long := "| A | B |\n|---|---|\n| 1 | 2 |\n\n" +
+		"```sh\necho hi\n```\n"
+
+	d := doc{Name: "Foo", rawFields: map[string]string{"Long": long}}
+	got := renderManPage("foo", d)
+
+	for _, want := range []string{".TS", ".TE", ".EX", "echo hi", ".EE"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderManPage output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "| A | B |") {
+		t.Errorf("table should be rendered as tbl macros, not left as raw pipes:\n%s", got)
+	}
+}
+
+// TestRenderManPageList asserts a leading list renders as .IP entries.
+func TestRenderManPageList(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/leading-list.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, ok := extractRawBlocks(src)["Long"]
+	if !ok {
+		t.Fatal("block Long not found in testdata/leading-list.md")
+	}
+
+	d := doc{Name: "Foo", rawFields: map[string]string{"Long": long}}
+	got := renderManPage("foo", d)
+
+	for _, want := range []string{".IP", "first item", "second item"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderManPage output missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// mdParser is shared across every file and fragment mdtogo parses; goldmark
+// parsers are safe for concurrent use once constructed.
+var mdParser = goldmark.New(goldmark.WithExtensions(extension.Table))
+
+var (
+	mdtogoOpenTag     = regexp.MustCompile(`^<!--mdtogo:([A-Z][A-Za-z0-9]*)-->\s*$`)
+	mdtogoCloseTag    = regexp.MustCompile(`^<!--mdtogo-->\s*$`)
+	mdtogoInternalTag = regexp.MustCompile(`(?s)^<!--mdtogo:([A-Z][A-Za-z0-9]*)\s+?(.*?)-->\s*$`)
+)
+
+// extractRawBlocks parses source as CommonMark and walks the resulting AST
+// looking for the HTML comment nodes that delimit mdtogo regions, returning
+// the *raw markdown source* spanned by each named region. Unlike the old
+// regex-over-the-whole-file approach, this locates the comments structurally
+// so a backtick or fence inside an Examples block is never mistaken for a
+// mdtogo tag.
+func extractRawBlocks(source []byte) map[string]string {
+	reader := text.NewReader(source)
+	doc := mdParser.Parser().Parse(reader)
+
+	blocks := make(map[string]string)
+
+	var openName string
+	var openStart int
+
+	flushOpen := func(end ast.Node) {
+		if openName == "" {
+			return
+		}
+		blocks[openName] = sliceSourceFrom(source, openStart, end)
+		openName = ""
+	}
+
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		html, ok := n.(*ast.HTMLBlock)
+		if !ok {
+			continue
+		}
+		raw := htmlBlockText(html, source)
+
+		if mdtogoCloseTag.MatchString(raw) {
+			flushOpen(n)
+			continue
+		}
+		if m := mdtogoOpenTag.FindStringSubmatch(raw); m != nil {
+			flushOpen(n) // tolerate an unterminated prior section
+			openName = m[1]
+			// Anchor on the end of the open tag's own HTML comment rather
+			// than the start of the following node's (trimmed) Lines(): a
+			// Heading, List or FencedCodeBlock's Lines() begin *after* that
+			// node's own marker ("# ", "- ", a fence delimiter line), which
+			// would otherwise silently drop it whenever a block opens
+			// directly with one of these instead of a plain paragraph. Any
+			// blank line(s) directly after the tag are skipped, matching the
+			// old behavior of starting at the first real content.
+			openStart = skipBlankLines(source, htmlBlockEndOffset(html))
+			continue
+		}
+		if m := mdtogoInternalTag.FindStringSubmatch(raw); m != nil {
+			blocks[m[1]] = m[2]
+			continue
+		}
+	}
+	flushOpen(nil)
+
+	return blocks
+}
+
+// htmlBlockText returns the raw source text of an HTML block, including its
+// closing line (e.g. the "-->" of a multi-line comment), if any.
+func htmlBlockText(n *ast.HTMLBlock, source []byte) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.Write(seg.Value(source))
+	}
+	if n.HasClosure() {
+		closure := n.ClosureLine
+		b.Write(closure.Value(source))
+	}
+	return b.String()
+}
+
+// sliceSourceFrom returns the raw source text starting at the byte offset
+// from, up to (but not including) the start of "to", or to the end of
+// source if to is nil. This preserves nested fences, tables, opening
+// headings/list markers and any other markdown verbatim, since it never
+// re-serializes the source -- it only locates byte offsets via the AST.
+func sliceSourceFrom(source []byte, from int, to ast.Node) string {
+	end := len(source)
+	if to != nil {
+		if s, ok := nodeStartOffset(to); ok {
+			end = s
+		}
+	}
+	if end < from {
+		end = from
+	}
+	return string(source[from:end])
+}
+
+// htmlBlockEndOffset returns the byte offset in source immediately after an
+// HTML block's own content (its closure line, if it has one, otherwise its
+// last line) -- i.e. the start of whatever line follows it. Unlike the
+// Lines() of a Heading, List or FencedCodeBlock, an HTMLBlock's Lines() are
+// never trimmed of their own markup, so this offset can be trusted as the
+// exact start of the raw source that follows an mdtogo open tag.
+func htmlBlockEndOffset(n *ast.HTMLBlock) int {
+	if n.HasClosure() {
+		return n.ClosureLine.Stop
+	}
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return 0
+	}
+	return lines.At(lines.Len() - 1).Stop
+}
+
+// skipBlankLines advances offset past any whitespace-only lines, returning
+// the start of the first line that has non-whitespace content (or the end
+// of source, if there isn't one).
+func skipBlankLines(source []byte, offset int) int {
+	for offset < len(source) {
+		nl := bytes.IndexByte(source[offset:], '\n')
+		lineEnd := len(source)
+		line := source[offset:]
+		if nl != -1 {
+			line = source[offset : offset+nl]
+			lineEnd = offset + nl + 1
+		}
+		if len(bytes.TrimSpace(line)) != 0 {
+			return offset
+		}
+		offset = lineEnd
+	}
+	return offset
+}
+
+// nodeStartOffset returns the byte offset in the source where n's content
+// begins, found by descending into n's subtree for the first block that
+// exposes source lines.
+func nodeStartOffset(n ast.Node) (int, bool) {
+	if lines, ok := linesOf(n); ok && lines.Len() > 0 {
+		return lines.At(0).Start, true
+	}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if off, ok := nodeStartOffset(c); ok {
+			return off, true
+		}
+	}
+	return 0, false
+}
+
+// linesOf returns a node's backing source lines, for the block node types
+// that expose them (Paragraph, Heading, FencedCodeBlock, HTMLBlock, ...).
+func linesOf(n ast.Node) (*text.Segments, bool) {
+	if b, ok := n.(interface{ Lines() *text.Segments }); ok {
+		return b.Lines(), true
+	}
+	return nil, false
+}
+
+// renderMarkdown parses a raw markdown fragment and renders it back to the
+// plain, indented text used in cobra help output: headings keep their "#"
+// markers, fenced code keeps its language tag and is indented uniformly,
+// unordered lists become "-" bullets and ordered lists "N." items, and
+// inline code spans keep their backticks rather than
+// being escaped into a string-concatenation hack.
+func renderMarkdown(raw string) string {
+	source := []byte(strings.Trim(raw, "\n") + "\n")
+	reader := text.NewReader(source)
+	doc := mdParser.Parser().Parse(reader)
+
+	var b strings.Builder
+	renderChildren(&b, doc, source)
+	return strings.Trim(b.String(), "\n") + "\n"
+}
+
+func renderChildren(b *strings.Builder, parent ast.Node, source []byte) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		renderBlockNode(b, n, source)
+	}
+}
+
+func renderBlockNode(b *strings.Builder, n ast.Node, source []byte) {
+	switch node := n.(type) {
+	case *ast.Heading:
+		b.WriteString(strings.Repeat("#", node.Level) + " " + renderInline(node, source) + "\n\n")
+	case *ast.Paragraph, *ast.TextBlock:
+		b.WriteString(renderInline(n, source) + "\n\n")
+	case *ast.FencedCodeBlock:
+		renderFencedCodeBlock(b, node, source)
+	case *ast.CodeBlock:
+		renderIndentedLines(b, node.Lines(), source, "")
+		b.WriteString("\n")
+	case *ast.List:
+		renderList(b, node, source)
+	case *ast.Blockquote:
+		var inner strings.Builder
+		renderChildren(&inner, node, source)
+		for _, line := range strings.Split(strings.TrimRight(inner.String(), "\n"), "\n") {
+			b.WriteString("> " + line + "\n")
+		}
+		b.WriteString("\n")
+	case *ast.ThematicBreak:
+		b.WriteString("---\n\n")
+	case *extast.Table:
+		renderTable(b, node, source)
+	default:
+		// Unknown container (e.g. a custom extension node): fall back to
+		// rendering its children so content isn't silently dropped.
+		renderChildren(b, n, source)
+	}
+}
+
+// renderFencedCodeBlock preserves the fence's language tag and indents the
+// fence markers and its content uniformly by two spaces.
+func renderFencedCodeBlock(b *strings.Builder, node *ast.FencedCodeBlock, source []byte) {
+	lang := ""
+	if node.Info != nil {
+		lang = string(node.Language(source))
+	}
+	b.WriteString("  ```" + lang + "\n")
+	renderIndentedLines(b, node.Lines(), source, "  ")
+	b.WriteString("  ```\n\n")
+}
+
+func renderIndentedLines(b *strings.Builder, lines *text.Segments, source []byte, indent string) {
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.WriteString(indent)
+		b.Write(seg.Value(source))
+	}
+}
+
+func renderList(b *strings.Builder, node *ast.List, source []byte) {
+	i := node.Start
+	for item := node.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "- "
+		if node.IsOrdered() {
+			marker = strconv.Itoa(i) + ". "
+			i++
+		}
+
+		var inner strings.Builder
+		renderChildren(&inner, item, source)
+		lines := strings.Split(strings.TrimRight(inner.String(), "\n"), "\n")
+		for j, line := range lines {
+			if j == 0 {
+				b.WriteString(marker + line + "\n")
+			} else {
+				b.WriteString(strings.Repeat(" ", len(marker)) + line + "\n")
+			}
+		}
+	}
+	b.WriteString("\n")
+}
+
+// renderTable renders a table extension node as a plain pipe table, since
+// cobra help output has no HTML to render it into.
+func renderTable(b *strings.Builder, node *extast.Table, source []byte) {
+	var rows [][]string
+	for r := node.FirstChild(); r != nil; r = r.NextSibling() {
+		var row []string
+		for c := r.FirstChild(); c != nil; c = c.NextSibling() {
+			row = append(row, strings.TrimSpace(renderInline(c, source)))
+		}
+		rows = append(rows, row)
+
+		if _, ok := r.(*extast.TableHeader); ok {
+			sep := make([]string, len(row))
+			for i := range sep {
+				sep[i] = "---"
+			}
+			rows = append(rows, sep)
+		}
+	}
+
+	for _, row := range rows {
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	b.WriteString("\n")
+}
+
+// renderInline renders the inline children of n (text, code spans, emphasis,
+// links) back to plain text.
+func renderInline(n ast.Node, source []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch in := c.(type) {
+		case *ast.Text:
+			b.Write(in.Segment.Value(source))
+			if in.SoftLineBreak() || in.HardLineBreak() {
+				b.WriteString("\n")
+			}
+		case *ast.CodeSpan:
+			b.WriteString("`" + renderInline(in, source) + "`")
+		case *ast.Emphasis:
+			marker := strings.Repeat("*", in.Level)
+			b.WriteString(marker + renderInline(in, source) + marker)
+		case *ast.Link:
+			b.WriteString("[" + renderInline(in, source) + "](" + string(in.Destination) + ")")
+		case *ast.AutoLink:
+			b.Write(in.URL(source))
+		case *ast.RawHTML:
+			for i := 0; i < in.Segments.Len(); i++ {
+				seg := in.Segments.At(i)
+				b.Write(seg.Value(source))
+			}
+		default:
+			b.WriteString(renderInline(c, source))
+		}
+	}
+	return b.String()
+}
+
+// goLiteral renders s as a Go string literal suitable for docs.go. Raw
+// strings are preferred for readability, but content that itself contains a
+// backtick (e.g. an inline code span) falls back to a quoted interpreted
+// string instead of the old `` ` + "`" + ` `` concatenation hack.
+func goLiteral(s string) string {
+	if !strings.Contains(s, "`") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
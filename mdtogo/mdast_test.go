@@ -0,0 +1,75 @@
+// Copyright 2019 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestRenderMarkdownGolden exercises the parts of the old regex-based parser
+// that were the most fragile: a fenced code block nested inside a larger
+// fence, a table, and inline code spans sitting next to plain prose.
+func TestRenderMarkdownGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		srcFile string
+		varName string
+	}{
+		{"nested fences", "testdata/nested-fences.md", "Examples"},
+		{"table", "testdata/table.md", "Long"},
+		{"inline code", "testdata/inline-code.md", "Long"},
+		{"leading fence", "testdata/leading-fence.md", "Examples"},
+		{"leading heading", "testdata/leading-heading.md", "Long"},
+		{"leading list", "testdata/leading-list.md", "Long"},
+		{"leading blank line", "testdata/leading-blank-line.md", "Long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := ioutil.ReadFile(tt.srcFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, ok := extractRawBlocks(src)[tt.varName]
+			if !ok {
+				t.Fatalf("block %s not found in %s", tt.varName, tt.srcFile)
+			}
+			got := renderMarkdown(raw)
+
+			goldenFile := strings.TrimSuffix(tt.srcFile, ".md") + ".golden"
+			want, err := ioutil.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != string(want) {
+				t.Errorf("renderMarkdown(%s) = %q, want %q", tt.srcFile, got, string(want))
+			}
+		})
+	}
+}
+
+// TestExtractRawBlocksSkipsBlankLineAfterTag checks the *raw* extracted
+// block directly, rather than through renderMarkdown (which trims leading
+// and trailing blank lines on its own and so wouldn't catch a regression
+// here): a blank line right after the open tag must not become part of the
+// block, since mdtogo:include substitutes raw blocks verbatim into their
+// including document with no trimming of its own.
+func TestExtractRawBlocksSkipsBlankLineAfterTag(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/leading-blank-line.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, ok := extractRawBlocks(src)["Long"]
+	if !ok {
+		t.Fatal("block Long not found in testdata/leading-blank-line.md")
+	}
+	if strings.HasPrefix(raw, "\n") {
+		t.Errorf("extractRawBlocks kept a leading blank line: %q", raw)
+	}
+}